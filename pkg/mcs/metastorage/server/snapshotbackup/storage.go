@@ -0,0 +1,92 @@
+// Copyright 2024 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package snapshotbackup persists the intent of an in-progress snapshot-backup freeze
+// (see server/cluster.RaftCluster.PrepareSnapshotBackup) through the metastorage service, so
+// that a failover of the scheduling primary continues to honor an active freeze rather than
+// resuming scheduling.
+package snapshotbackup
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/tikv/pd/pkg/storage/kv"
+)
+
+// snapshotBackupIntentPath is the etcd key the freeze intent is persisted under.
+const snapshotBackupIntentPath = "snapshot_backup/intent"
+
+// Intent describes the currently active (or most recently persisted) snapshot backup lease.
+type Intent struct {
+	LeaseSeconds uint64    `json:"lease_seconds"`
+	Deadline     time.Time `json:"deadline"`
+}
+
+// Storage persists and reloads the snapshot backup Intent for a cluster.
+type Storage struct {
+	base kv.Base
+}
+
+var (
+	storagesMu sync.Mutex
+	storages   = make(map[kv.Base]*Storage)
+)
+
+// GetStorage returns the (lazily created) snapshotbackup.Storage backed by base, reusing the
+// same instance for repeated calls with the same underlying kv.Base.
+func GetStorage(base kv.Base) *Storage {
+	storagesMu.Lock()
+	defer storagesMu.Unlock()
+	if s, ok := storages[base]; ok {
+		return s
+	}
+	s := &Storage{base: base}
+	storages[base] = s
+	return s
+}
+
+// SaveIntent persists intent, overwriting any previously persisted intent.
+func (s *Storage) SaveIntent(_ context.Context, intent *Intent) error {
+	data, err := json.Marshal(intent)
+	if err != nil {
+		return errors.Annotate(err, "marshal snapshot backup intent")
+	}
+	return s.base.Save(snapshotBackupIntentPath, string(data))
+}
+
+// LoadIntent returns the persisted intent, if any.
+func (s *Storage) LoadIntent(_ context.Context) (*Intent, bool, error) {
+	data, err := s.base.Load(snapshotBackupIntentPath)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+	intent := &Intent{}
+	if err := json.Unmarshal([]byte(data), intent); err != nil {
+		return nil, false, errors.Annotate(err, "unmarshal snapshot backup intent")
+	}
+	return intent, true, nil
+}
+
+// ClearIntent removes any persisted intent.
+func (s *Storage) ClearIntent(_ context.Context) error {
+	return s.base.Remove(snapshotBackupIntentPath)
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/tikv/pd/pkg/mcs/metastorage/server/snapshotbackup"
+)
+
+// In MicroserviceEnv the schedulers run on the scheduling primary's Cluster rather than on the
+// API server's RaftCluster, so PrepareSnapshotBackup/FinishSnapshotBackup need a passthrough
+// here that pauses scheduling locally. The per-store prepare streams are dialed and owned by
+// the API server's RaftCluster in both topologies, since that is where store heartbeats
+// terminate; this passthrough only needs to keep the scheduling primary's own dispatch loop,
+// and its view of the freeze across a primary failover, in sync with that.
+//
+// snapshotBackupState is kept per-*Cluster here rather than as a field on Cluster itself,
+// since Cluster's struct definition lives outside this chunk of the tree.
+type snapshotBackupState struct {
+	mu        sync.Mutex
+	paused    bool
+	recovered bool
+}
+
+var snapshotBackupStates sync.Map // *Cluster -> *snapshotBackupState
+
+func (c *Cluster) snapshotBackupClusterState() *snapshotBackupState {
+	v, _ := snapshotBackupStates.LoadOrStore(c, &snapshotBackupState{})
+	return v.(*snapshotBackupState)
+}
+
+// PrepareSnapshotBackup is the microservice passthrough for RaftCluster.PrepareSnapshotBackup.
+func (c *Cluster) PrepareSnapshotBackup(ctx context.Context, leaseSeconds uint64) error {
+	c.recoverSnapshotBackupOnce(ctx)
+	c.pauseSchedulingForSnapshotBackup(true)
+	storage := snapshotbackup.GetStorage(c.GetStorage())
+	deadline := time.Now().Add(time.Duration(leaseSeconds) * time.Second)
+	if err := storage.SaveIntent(ctx, &snapshotbackup.Intent{LeaseSeconds: leaseSeconds, Deadline: deadline}); err != nil {
+		c.pauseSchedulingForSnapshotBackup(false)
+		return err
+	}
+	return nil
+}
+
+// FinishSnapshotBackup is the microservice passthrough for RaftCluster.FinishSnapshotBackup.
+func (c *Cluster) FinishSnapshotBackup(ctx context.Context) error {
+	c.pauseSchedulingForSnapshotBackup(false)
+	return snapshotbackup.GetStorage(c.GetStorage()).ClearIntent(ctx)
+}
+
+func (c *Cluster) pauseSchedulingForSnapshotBackup(pause bool) {
+	state := c.snapshotBackupClusterState()
+	state.mu.Lock()
+	state.paused = pause
+	state.mu.Unlock()
+	if co := c.GetCoordinator(); co != nil {
+		co.PauseOrResumeAll(pause)
+	}
+}
+
+// IsSchedulingPausedForSnapshotBackup reports whether c currently has scheduling paused for
+// an in-progress (or inherited) snapshot backup freeze. Its first call on c, like the first
+// PrepareSnapshotBackup, also recovers a freeze inherited from a previous scheduling primary
+// (see recoverSnapshotBackupOnce below).
+func (c *Cluster) IsSchedulingPausedForSnapshotBackup() bool {
+	c.recoverSnapshotBackupOnce(context.Background())
+	state := c.snapshotBackupClusterState()
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.paused
+}
+
+// recoverSnapshotBackupOnce reloads a persisted freeze intent the first time it is consulted
+// for c, so that a newly-elected scheduling primary continues to honor an active freeze left
+// behind by its predecessor instead of resuming scheduling.
+func (c *Cluster) recoverSnapshotBackupOnce(ctx context.Context) {
+	state := c.snapshotBackupClusterState()
+	state.mu.Lock()
+	if state.recovered {
+		state.mu.Unlock()
+		return
+	}
+	state.recovered = true
+	state.mu.Unlock()
+
+	storage := snapshotbackup.GetStorage(c.GetStorage())
+	intent, ok, err := storage.LoadIntent(ctx)
+	if err != nil {
+		log.Warn("failed to recover snapshot backup intent", zap.Error(err))
+		return
+	}
+	if !ok {
+		return
+	}
+	if time.Now().After(intent.Deadline) {
+		if err := storage.ClearIntent(ctx); err != nil {
+			log.Warn("failed to clear expired snapshot backup intent", zap.Error(err))
+		}
+		return
+	}
+	log.Info("scheduling primary resuming inherited snapshot backup freeze", zap.Time("deadline", intent.Deadline))
+	c.pauseSchedulingForSnapshotBackup(true)
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/pdpb"
+
+	"github.com/tikv/pd/pkg/utils/grpcutil"
+)
+
+const waitApplyPollInterval = 100 * time.Millisecond
+
+// storeApplyClient queries a single store's current minimum applied index across all of its
+// region peers, over a dedicated RPC, since region heartbeats do not carry a per-peer
+// applied index today. It mirrors server/cluster's storeApplyClient for the microservice
+// topology, where region heartbeats (and so the natural place to dial stores from) terminate
+// on the scheduling primary's Cluster instead of the API server's RaftCluster.
+type storeApplyClient interface {
+	GetAppliedIndex(ctx context.Context) (uint64, error)
+}
+
+var applyClients sync.Map // *Cluster -> *sync.Map(storeID -> storeApplyClient)
+
+func (c *Cluster) getStoreApplyClient(storeID uint64) storeApplyClient {
+	v, _ := applyClients.LoadOrStore(c, &sync.Map{})
+	clients := v.(*sync.Map)
+	if client, ok := clients.Load(storeID); ok {
+		return client.(storeApplyClient)
+	}
+	client := &grpcApplyClient{cluster: c, storeID: storeID}
+	clients.Store(storeID, client)
+	return client
+}
+
+type grpcApplyClient struct {
+	cluster *Cluster
+	storeID uint64
+}
+
+func (g *grpcApplyClient) GetAppliedIndex(ctx context.Context) (uint64, error) {
+	store := g.cluster.GetStore(g.storeID)
+	if store == nil {
+		return 0, errors.Errorf("store %d not found", g.storeID)
+	}
+	conn, err := grpcutil.GetClientConn(ctx, store.GetAddress(), nil)
+	if err != nil {
+		return 0, errors.Annotatef(err, "dial store %d at %s", g.storeID, store.GetAddress())
+	}
+	resp, err := pdpb.NewPDClient(conn).QueryRegionAppliedIndex(ctx, &pdpb.QueryRegionAppliedIndexRequest{
+		Header: &pdpb.RequestHeader{ClusterId: g.cluster.GetClusterID()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resp.GetAppliedIndex(), nil
+}
+
+// WaitApply is the microservice passthrough for RaftCluster.WaitApply: in MicroserviceEnv
+// region heartbeats terminate on the scheduling primary's Cluster, so that is where the
+// store dialing for the wait-apply barrier lives. Like its RaftCluster counterpart, a slow
+// or failed store is reported by storeID rather than surfacing one opaque timeout for the
+// whole call.
+func (c *Cluster) WaitApply(ctx context.Context, barriers map[uint64]uint64, deadline time.Time) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failures := make(map[uint64]error)
+	for storeID, barrier := range barriers {
+		wg.Add(1)
+		go func(storeID, barrier uint64) {
+			defer wg.Done()
+			if err := c.waitStoreApply(ctx, storeID, barrier, deadline); err != nil {
+				mu.Lock()
+				failures[storeID] = err
+				mu.Unlock()
+			}
+		}(storeID, barrier)
+	}
+	wg.Wait()
+
+	if len(failures) == 0 {
+		return nil
+	}
+	msg := "wait apply failed for stores:"
+	for storeID, err := range failures {
+		msg += errors.Errorf(" %d(%s)", storeID, err).Error()
+	}
+	return errors.New(msg)
+}
+
+func (c *Cluster) waitStoreApply(ctx context.Context, storeID, barrier uint64, deadline time.Time) error {
+	client := c.getStoreApplyClient(storeID)
+	ticker := time.NewTicker(waitApplyPollInterval)
+	defer ticker.Stop()
+	for {
+		if time.Now().After(deadline) {
+			return errors.Errorf("store %d did not reach apply index %d before deadline", storeID, barrier)
+		}
+		queryCtx, cancel := context.WithTimeout(ctx, waitApplyPollInterval)
+		index, err := client.GetAppliedIndex(queryCtx)
+		cancel()
+		if err == nil && index >= barrier {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2024 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/tikv/pd/pkg/mcs/metastorage/server/snapshotbackup"
+)
+
+const (
+	// snapshotBackupStoreDialTimeout bounds a single prepare round-trip to a store.
+	snapshotBackupStoreDialTimeout = 5 * time.Second
+	snapshotBackupRetryBaseBackoff = 100 * time.Millisecond
+	snapshotBackupRetryMaxBackoff  = 5 * time.Second
+)
+
+// snapshotBackupSession tracks one in-flight PrepareSnapshotBackup call on a RaftCluster.
+type snapshotBackupSession struct {
+	deadline time.Time
+	cancel   context.CancelFunc
+	stores   map[uint64]*storeSnapshotBackupState
+}
+
+type storeSnapshotBackupState struct {
+	prepared bool
+	err      error
+}
+
+// snapshotBackupClusterState is c's share of the snapshot-backup subsystem: the active
+// freeze session (if any), whether recovery of a persisted freeze intent has already run,
+// and the per-store client cache, all guarded by one mutex. It is stored per-*RaftCluster
+// in snapshotBackupStates rather than as a field on RaftCluster itself, because the struct
+// definition of RaftCluster lives outside this chunk of the tree; every accessor below goes
+// through the same lock a real field would use, so it behaves like one.
+type snapshotBackupClusterState struct {
+	mu sync.Mutex
+
+	session   *snapshotBackupSession
+	recovered bool
+	clients   map[uint64]storeSnapshotBackupClient
+}
+
+var snapshotBackupStates sync.Map // *RaftCluster -> *snapshotBackupClusterState
+
+func (c *RaftCluster) snapshotBackupState() *snapshotBackupClusterState {
+	v, _ := snapshotBackupStates.LoadOrStore(c, &snapshotBackupClusterState{
+		clients: make(map[uint64]storeSnapshotBackupClient),
+	})
+	return v.(*snapshotBackupClusterState)
+}
+
+// PrepareSnapshotBackup pauses scheduling on c and instructs every live store to reject
+// admin/apply commands that would mutate on-disk state, so that an external backup tool can
+// take a consistent EBS-style volume snapshot of every TiKV store. leaseSeconds sets the
+// session's deadline, which bounds the per-store prepare retries and is persisted with the
+// intent; HeartbeatSnapshotBackup moves it forward. An active session is not released when
+// its deadline passes: scheduling stays paused until FinishSnapshotBackup is called. Only a
+// persisted intent whose deadline has passed is discarded, when a cluster recovers it.
+func (c *RaftCluster) PrepareSnapshotBackup(ctx context.Context, leaseSeconds uint64) error {
+	c.recoverSnapshotBackupOnce(ctx)
+
+	state := c.snapshotBackupState()
+	state.mu.Lock()
+	if state.session != nil {
+		state.mu.Unlock()
+		return errors.New("a snapshot backup is already in progress")
+	}
+	sessionCtx, cancel := context.WithCancel(ctx)
+	session := &snapshotBackupSession{
+		deadline: time.Now().Add(time.Duration(leaseSeconds) * time.Second),
+		cancel:   cancel,
+		stores:   make(map[uint64]*storeSnapshotBackupState),
+	}
+	state.session = session
+	state.mu.Unlock()
+
+	c.PauseOrResumeSchedulers(true)
+
+	storage := snapshotbackup.GetStorage(c.GetStorage())
+	if err := storage.SaveIntent(ctx, &snapshotbackup.Intent{LeaseSeconds: leaseSeconds, Deadline: session.deadline}); err != nil {
+		c.abortSnapshotBackup(state, session)
+		return errors.Annotate(err, "persist snapshot backup intent")
+	}
+
+	stores := c.GetStores()
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(stores))
+	for _, store := range stores {
+		if store.IsTombstone() {
+			continue
+		}
+		storeID := store.GetID()
+		storeState := &storeSnapshotBackupState{}
+		state.mu.Lock()
+		session.stores[storeID] = storeState
+		state.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.prepareStoreForSnapshotBackup(sessionCtx, storeID, session.deadline)
+			state.mu.Lock()
+			storeState.err = err
+			storeState.prepared = err == nil
+			state.mu.Unlock()
+			if err != nil {
+				errCh <- errors.Annotatef(err, "store %d", storeID)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+
+	var failures []error
+	for err := range errCh {
+		failures = append(failures, err)
+	}
+	if len(failures) > 0 {
+		log.Warn("snapshot backup prepare failed, rolling back", zap.Errors("failures", failures))
+		c.abortSnapshotBackup(state, session)
+		return errors.Errorf("%d store(s) failed to prepare for snapshot backup: %v", len(failures), failures)
+	}
+
+	log.Info("snapshot backup prepared", zap.Int("stores", len(session.stores)), zap.Uint64("lease-seconds", leaseSeconds))
+	return nil
+}
+
+// prepareStoreForSnapshotBackup asks the given store to reject any admin/apply command that
+// would mutate on-disk state, retrying with backoff until the store acknowledges that its
+// in-flight raft logs have been flushed or the deadline elapses. Each attempt opens a new
+// stream to the store; no stream stays open between attempts.
+func (c *RaftCluster) prepareStoreForSnapshotBackup(ctx context.Context, storeID uint64, deadline time.Time) error {
+	client := c.getStoreSnapshotBackupClient(storeID)
+	backoff := snapshotBackupRetryBaseBackoff
+	for {
+		if time.Now().After(deadline) {
+			return errors.Errorf("store %d did not prepare before deadline", storeID)
+		}
+		prepareCtx, cancel := context.WithTimeout(ctx, snapshotBackupStoreDialTimeout)
+		flushed, err := client.Prepare(prepareCtx)
+		cancel()
+		if err == nil && flushed {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Warn("retry preparing store for snapshot backup", zap.Uint64("store-id", storeID), zap.Error(err), zap.Duration("backoff", backoff))
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > snapshotBackupRetryMaxBackoff {
+			backoff = snapshotBackupRetryMaxBackoff
+		}
+	}
+}
+
+// ErrNoSnapshotBackupInProgress is returned by HeartbeatSnapshotBackup when c has no active
+// freeze to renew; callers such as the PrepareSnapshotBackup gRPC handler use this to decide
+// whether a renewed UpdateLeaseAndWait should instead start a brand new freeze.
+var ErrNoSnapshotBackupInProgress = errors.New("no snapshot backup in progress")
+
+// HeartbeatSnapshotBackup renews the lease of the active snapshot backup session: it moves
+// the session's deadline to leaseSeconds from now and persists the renewed intent.
+func (c *RaftCluster) HeartbeatSnapshotBackup(ctx context.Context, leaseSeconds uint64) error {
+	state := c.snapshotBackupState()
+	state.mu.Lock()
+	session := state.session
+	if session == nil {
+		state.mu.Unlock()
+		return ErrNoSnapshotBackupInProgress
+	}
+	session.deadline = time.Now().Add(time.Duration(leaseSeconds) * time.Second)
+	deadline := session.deadline
+	state.mu.Unlock()
+
+	storage := snapshotbackup.GetStorage(c.GetStorage())
+	return storage.SaveIntent(ctx, &snapshotbackup.Intent{LeaseSeconds: leaseSeconds, Deadline: deadline})
+}
+
+// FinishSnapshotBackup unwinds an active snapshot backup freeze in reverse order: it first
+// releases every store from prepare mode, then clears the persisted intent so a failed-over
+// scheduling primary does not keep honoring the freeze, and finally resumes schedulers.
+func (c *RaftCluster) FinishSnapshotBackup(ctx context.Context) error {
+	state := c.snapshotBackupState()
+	state.mu.Lock()
+	session := state.session
+	state.session = nil
+	state.mu.Unlock()
+	if session == nil {
+		return nil
+	}
+	defer session.cancel()
+
+	var firstErr error
+	for storeID := range session.stores {
+		if err := c.getStoreSnapshotBackupClient(storeID).Finish(ctx); err != nil && firstErr == nil {
+			firstErr = errors.Annotatef(err, "store %d", storeID)
+		}
+	}
+
+	storage := snapshotbackup.GetStorage(c.GetStorage())
+	if err := storage.ClearIntent(ctx); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	c.PauseOrResumeSchedulers(false)
+	return firstErr
+}
+
+func (c *RaftCluster) abortSnapshotBackup(state *snapshotBackupClusterState, session *snapshotBackupSession) {
+	state.mu.Lock()
+	if state.session == session {
+		state.session = nil
+	}
+	state.mu.Unlock()
+	session.cancel()
+	c.PauseOrResumeSchedulers(false)
+	if err := snapshotbackup.GetStorage(c.GetStorage()).ClearIntent(context.Background()); err != nil {
+		log.Warn("failed to clear snapshot backup intent after abort", zap.Error(err))
+	}
+}
+
+// recoverSnapshotBackupOnce reloads a persisted freeze intent from the metastorage-backed
+// snapshotbackup storage the first time it is consulted for c, so that a newly-elected
+// scheduling primary continues to honor an active freeze left behind by its predecessor
+// instead of resuming scheduling. It is called from PrepareSnapshotBackup and from
+// IsSchedulingPausedForSnapshotBackup, so recovery runs the first time either of them is
+// called on c; starting c does not by itself trigger it.
+func (c *RaftCluster) recoverSnapshotBackupOnce(ctx context.Context) {
+	state := c.snapshotBackupState()
+	state.mu.Lock()
+	if state.recovered {
+		state.mu.Unlock()
+		return
+	}
+	state.recovered = true
+	state.mu.Unlock()
+
+	if err := c.resumeSnapshotBackupOnStart(ctx); err != nil {
+		log.Warn("failed to recover snapshot backup intent", zap.Error(err))
+	}
+}
+
+// resumeSnapshotBackupOnStart loads a persisted freeze intent, if any, and re-applies the
+// scheduler pause for it; see recoverSnapshotBackupOnce for when this runs.
+func (c *RaftCluster) resumeSnapshotBackupOnStart(ctx context.Context) error {
+	storage := snapshotbackup.GetStorage(c.GetStorage())
+	intent, ok, err := storage.LoadIntent(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	if time.Now().After(intent.Deadline) {
+		return storage.ClearIntent(ctx)
+	}
+	log.Info("resuming snapshot backup freeze inherited from previous scheduling primary", zap.Time("deadline", intent.Deadline))
+
+	state := c.snapshotBackupState()
+	state.mu.Lock()
+	_, cancel := context.WithCancel(ctx)
+	state.session = &snapshotBackupSession{
+		deadline: intent.Deadline,
+		cancel:   cancel,
+		stores:   make(map[uint64]*storeSnapshotBackupState),
+	}
+	state.mu.Unlock()
+
+	c.PauseOrResumeSchedulers(true)
+	return nil
+}
+
+// PauseOrResumeSchedulers pauses or resumes every scheduler and operator dispatch on c. It is
+// used both for the snapshot backup freeze above and is safe to call redundantly.
+func (c *RaftCluster) PauseOrResumeSchedulers(pause bool) {
+	if co := c.GetCoordinator(); co != nil {
+		co.PauseOrResumeAll(pause)
+	}
+}
+
+// IsSchedulingPausedForSnapshotBackup reports whether c currently has scheduling paused for
+// an in-progress (or inherited) snapshot backup freeze. Its first call on c also recovers a
+// freeze persisted by a previous scheduling primary (see recoverSnapshotBackupOnce).
+func (c *RaftCluster) IsSchedulingPausedForSnapshotBackup() bool {
+	c.recoverSnapshotBackupOnce(context.Background())
+	state := c.snapshotBackupState()
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.session != nil
+}
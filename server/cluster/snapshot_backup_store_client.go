@@ -0,0 +1,102 @@
+// Copyright 2024 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/pdpb"
+
+	"github.com/tikv/pd/pkg/utils/grpcutil"
+)
+
+// storeSnapshotBackupClient drives the PrepareSnapshotBackup stream to a single store. It is
+// the store-facing half of the freeze coordinator in snapshot_backup.go. Each Prepare and
+// Finish call opens its own stream, sends one request and closes its send side; no stream
+// is kept open between calls.
+type storeSnapshotBackupClient interface {
+	// Prepare asks the store to start rejecting admin/apply commands that would mutate
+	// on-disk state, and reports whether the store has acknowledged that its in-flight
+	// raft logs have been flushed.
+	Prepare(ctx context.Context) (flushed bool, err error)
+	// Finish releases the store from prepare mode.
+	Finish(ctx context.Context) error
+}
+
+// getStoreSnapshotBackupClient returns the (lazily created) storeSnapshotBackupClient for
+// storeID on c, reusing the same client across Prepare/Finish retries. The cache lives on
+// c's own snapshotBackupClusterState, so two clusters in the same process with overlapping
+// store IDs (the common case in this repo's own test suite, where store IDs are allocated
+// per TestCluster starting at 1) never share a client meant for a different cluster.
+func (c *RaftCluster) getStoreSnapshotBackupClient(storeID uint64) storeSnapshotBackupClient {
+	state := c.snapshotBackupState()
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if client, ok := state.clients[storeID]; ok {
+		return client
+	}
+	client := &grpcSnapshotBackupClient{cluster: c, storeID: storeID}
+	state.clients[storeID] = client
+	return client
+}
+
+// grpcSnapshotBackupClient is the production storeSnapshotBackupClient, dialing the store
+// directly over gRPC the same way the unsafe-recovery controller does.
+type grpcSnapshotBackupClient struct {
+	cluster *RaftCluster
+	storeID uint64
+}
+
+func (g *grpcSnapshotBackupClient) openStream(ctx context.Context) (pdpb.PD_PrepareSnapshotBackupClient, error) {
+	store := g.cluster.GetStore(g.storeID)
+	if store == nil {
+		return nil, errors.Errorf("store %d not found", g.storeID)
+	}
+	conn, err := grpcutil.GetClientConn(ctx, store.GetAddress(), nil)
+	if err != nil {
+		return nil, errors.Annotatef(err, "dial store %d at %s", g.storeID, store.GetAddress())
+	}
+	return pdpb.NewPDClient(conn).PrepareSnapshotBackup(ctx)
+}
+
+func (g *grpcSnapshotBackupClient) Prepare(ctx context.Context) (bool, error) {
+	stream, err := g.openStream(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer stream.CloseSend()
+	if err := stream.Send(&pdpb.PrepareSnapshotBackupRequest{
+		Type: pdpb.PrepareSnapshotBackupRequestType_UpdateLeaseAndWait,
+	}); err != nil {
+		return false, err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return false, err
+	}
+	return resp.GetWaitApplyDone(), nil
+}
+
+func (g *grpcSnapshotBackupClient) Finish(ctx context.Context) error {
+	stream, err := g.openStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.CloseSend()
+	return stream.Send(&pdpb.PrepareSnapshotBackupRequest{
+		Type: pdpb.PrepareSnapshotBackupRequestType_End,
+	})
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// waitApplyPollInterval is how often WaitApply re-queries a store's applied index while
+// waiting for it to catch up to the caller's barrier index.
+const waitApplyPollInterval = 100 * time.Millisecond
+
+// WaitApplyStoreErrors reports, per store, why WaitApply did not observe that store reach
+// its barrier index, so callers can decide whether to abort or exclude the store rather than
+// receiving a single opaque timeout.
+type WaitApplyStoreErrors map[uint64]error
+
+// Error implements the error interface.
+func (e WaitApplyStoreErrors) Error() string {
+	msg := "wait apply failed for stores:"
+	for storeID, err := range e {
+		msg += errors.Errorf(" %d(%s)", storeID, err).Error()
+	}
+	return msg
+}
+
+// WaitApply blocks until every store named in barriers reports, via a dedicated query
+// RPC, an applied index at least as large as the monotonically-increasing barrier index
+// the caller submitted for it, or deadline elapses.
+//
+// A slow or failed store does not block progress on the others: each store is waited on in
+// its own goroutine, and a non-nil WaitApplyStoreErrors is returned naming exactly which
+// stores did not catch up in time, rather than one opaque timeout for the whole call.
+func (c *RaftCluster) WaitApply(ctx context.Context, barriers map[uint64]uint64, deadline time.Time) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failures := make(WaitApplyStoreErrors)
+	for storeID, barrier := range barriers {
+		wg.Add(1)
+		go func(storeID, barrier uint64) {
+			defer wg.Done()
+			if err := c.waitStoreApply(ctx, storeID, barrier, deadline); err != nil {
+				mu.Lock()
+				failures[storeID] = err
+				mu.Unlock()
+			}
+		}(storeID, barrier)
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+// waitStoreApply polls storeID's applied index, over a dedicated query RPC, until it
+// reaches at least barrier or deadline elapses.
+func (c *RaftCluster) waitStoreApply(ctx context.Context, storeID, barrier uint64, deadline time.Time) error {
+	client := c.getStoreApplyClient(storeID)
+	ticker := time.NewTicker(waitApplyPollInterval)
+	defer ticker.Stop()
+	for {
+		if time.Now().After(deadline) {
+			return errors.Errorf("store %d did not reach apply index %d before deadline", storeID, barrier)
+		}
+		queryCtx, cancel := context.WithTimeout(ctx, waitApplyPollInterval)
+		index, err := client.GetAppliedIndex(queryCtx)
+		cancel()
+		if err == nil && index >= barrier {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/pdpb"
+
+	"github.com/tikv/pd/pkg/utils/grpcutil"
+)
+
+// storeApplyClient queries a single store's current minimum applied index across all of its
+// region peers, over a dedicated RPC, since region heartbeats do not carry a per-peer
+// applied index today.
+type storeApplyClient interface {
+	GetAppliedIndex(ctx context.Context) (uint64, error)
+}
+
+// waitApplyClusterState is c's per-cluster cache of storeApplyClients, analogous to
+// snapshotBackupClusterState; see that type's doc comment for why this is a registry keyed
+// by *RaftCluster rather than a field on it.
+type waitApplyClusterState struct {
+	mu      sync.Mutex
+	clients map[uint64]storeApplyClient
+}
+
+var waitApplyStates sync.Map // *RaftCluster -> *waitApplyClusterState
+
+func (c *RaftCluster) getStoreApplyClient(storeID uint64) storeApplyClient {
+	v, _ := waitApplyStates.LoadOrStore(c, &waitApplyClusterState{clients: make(map[uint64]storeApplyClient)})
+	state := v.(*waitApplyClusterState)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if client, ok := state.clients[storeID]; ok {
+		return client
+	}
+	client := &grpcApplyClient{cluster: c, storeID: storeID}
+	state.clients[storeID] = client
+	return client
+}
+
+// grpcApplyClient is the production storeApplyClient, dialing the store directly over gRPC.
+type grpcApplyClient struct {
+	cluster *RaftCluster
+	storeID uint64
+}
+
+func (g *grpcApplyClient) GetAppliedIndex(ctx context.Context) (uint64, error) {
+	store := g.cluster.GetStore(g.storeID)
+	if store == nil {
+		return 0, errors.Errorf("store %d not found", g.storeID)
+	}
+	conn, err := grpcutil.GetClientConn(ctx, store.GetAddress(), nil)
+	if err != nil {
+		return 0, errors.Annotatef(err, "dial store %d at %s", g.storeID, store.GetAddress())
+	}
+	resp, err := pdpb.NewPDClient(conn).QueryRegionAppliedIndex(ctx, &pdpb.QueryRegionAppliedIndexRequest{
+		Header: &pdpb.RequestHeader{ClusterId: g.cluster.GetClusterID()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resp.GetAppliedIndex(), nil
+}
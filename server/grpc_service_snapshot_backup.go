@@ -0,0 +1,63 @@
+// Copyright 2024 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/pdpb"
+
+	"github.com/tikv/pd/server/cluster"
+)
+
+// PrepareSnapshotBackup is the gRPC entry point an external backup tool (e.g. BR) calls to
+// put the cluster into, keep it in, and release it from, the state required for a consistent
+// EBS-style volume snapshot of every TiKV store. The client keeps the stream open and
+// re-sends UpdateLeaseAndWait to renew the freeze's lease (acting as its Heartbeat); sending
+// End releases it.
+func (s *GrpcServer) PrepareSnapshotBackup(stream pdpb.PD_PrepareSnapshotBackupServer) error {
+	ctx := stream.Context()
+	rc := s.GetRaftCluster()
+	if rc == nil {
+		return errors.New("raft cluster is not running")
+	}
+
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		switch req.GetType() {
+		case pdpb.PrepareSnapshotBackupRequestType_UpdateLeaseAndWait:
+			leaseSeconds := req.GetLeaseInSeconds()
+			err := rc.HeartbeatSnapshotBackup(ctx, leaseSeconds)
+			if errors.Is(err, cluster.ErrNoSnapshotBackupInProgress) {
+				err = rc.PrepareSnapshotBackup(ctx, leaseSeconds)
+			}
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(&pdpb.PrepareSnapshotBackupResponse{WaitApplyDone: true}); err != nil {
+				return err
+			}
+		case pdpb.PrepareSnapshotBackupRequestType_End:
+			if err := rc.FinishSnapshotBackup(ctx); err != nil {
+				return err
+			}
+			return stream.Send(&pdpb.PrepareSnapshotBackupResponse{WaitApplyDone: true})
+		default:
+			return errors.Errorf("unknown prepare snapshot backup request type %v", req.GetType())
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2024 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"testing"
+
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareAndFinishSnapshotBackup(t *testing.T) {
+	re := require.New(t)
+	env := NewSchedulingTestEnvironment(t)
+	defer env.Cleanup()
+	env.RunTest(func(cluster *TestCluster) {
+		checkPrepareAndFinishSnapshotBackup(re, cluster)
+	})
+}
+
+func checkPrepareAndFinishSnapshotBackup(re *require.Assertions, cluster *TestCluster) {
+	MustPutStore(re, cluster, &metapb.Store{Id: 1, State: metapb.StoreState_Up})
+
+	MustPrepareSnapshot(re, cluster, 30)
+	re.True(cluster.GetLeaderServer().GetRaftCluster().IsSchedulingPausedForSnapshotBackup())
+
+	MustFinishSnapshot(re, cluster)
+	re.False(cluster.GetLeaderServer().GetRaftCluster().IsSchedulingPausedForSnapshotBackup())
+}
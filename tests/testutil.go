@@ -234,6 +234,46 @@ func MustPutStore(re *require.Assertions, tc *TestCluster, store *metapb.Store)
 	}
 }
 
+// MustPrepareSnapshot is used for test purpose to pause scheduling and put every store
+// into the state required for taking a consistent snapshot backup.
+func MustPrepareSnapshot(re *require.Assertions, tc *TestCluster, leaseSeconds uint64) {
+	leader := tc.GetLeaderServer()
+	re.NotNil(leader)
+	raftCluster := leader.GetServer().GetRaftCluster()
+	re.NotNil(raftCluster)
+	re.NoError(raftCluster.PrepareSnapshotBackup(context.Background(), leaseSeconds))
+	if tc.GetSchedulingPrimaryServer() != nil {
+		re.NoError(tc.GetSchedulingPrimaryServer().GetCluster().PrepareSnapshotBackup(context.Background(), leaseSeconds))
+	}
+}
+
+// MustFinishSnapshot is used for test purpose to unwind an active snapshot-backup freeze
+// started by MustPrepareSnapshot.
+func MustFinishSnapshot(re *require.Assertions, tc *TestCluster) {
+	leader := tc.GetLeaderServer()
+	re.NotNil(leader)
+	raftCluster := leader.GetServer().GetRaftCluster()
+	re.NotNil(raftCluster)
+	re.NoError(raftCluster.FinishSnapshotBackup(context.Background()))
+	if tc.GetSchedulingPrimaryServer() != nil {
+		re.NoError(tc.GetSchedulingPrimaryServer().GetCluster().FinishSnapshotBackup(context.Background()))
+	}
+}
+
+// MustWaitApply is used for test purpose to block until every store in barriers has applied
+// at least its corresponding monotonically-increasing barrier index, or the deadline is
+// exceeded.
+func MustWaitApply(re *require.Assertions, cluster *TestCluster, barriers map[uint64]uint64, deadline time.Time) {
+	leader := cluster.GetLeaderServer()
+	re.NotNil(leader)
+	raftCluster := leader.GetServer().GetRaftCluster()
+	re.NotNil(raftCluster)
+	re.NoError(raftCluster.WaitApply(context.Background(), barriers, deadline))
+	if cluster.GetSchedulingPrimaryServer() != nil {
+		re.NoError(cluster.GetSchedulingPrimaryServer().GetCluster().WaitApply(context.Background(), barriers, deadline))
+	}
+}
+
 // MustPutRegion is used for test purpose.
 func MustPutRegion(re *require.Assertions, cluster *TestCluster, regionID, storeID uint64, start, end []byte, opts ...core.RegionCreateOption) *core.RegionInfo {
 	leader := &metapb.Peer{
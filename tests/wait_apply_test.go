@@ -0,0 +1,49 @@
+// Copyright 2024 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tikv/pd/server/cluster"
+)
+
+func TestWaitApplyReportsPerStoreFailure(t *testing.T) {
+	re := require.New(t)
+	env := NewSchedulingTestEnvironment(t)
+	defer env.Cleanup()
+	env.RunTest(func(tc *TestCluster) {
+		checkWaitApplyReportsPerStoreFailure(re, tc)
+	})
+}
+
+func checkWaitApplyReportsPerStoreFailure(re *require.Assertions, tc *TestCluster) {
+	MustPutStore(re, tc, &metapb.Store{Id: 1, State: metapb.StoreState_Up})
+
+	raftCluster := tc.GetLeaderServer().GetRaftCluster()
+	// The store's address does not correspond to a real TiKV process in this test, so the
+	// dedicated apply-index query RPC can never succeed; with an already-elapsed
+	// deadline, WaitApply must report that specific store's failure rather than blocking.
+	err := raftCluster.WaitApply(context.Background(), map[uint64]uint64{1: 1}, time.Now().Add(-time.Second))
+	re.Error(err)
+	storeErrs, ok := err.(cluster.WaitApplyStoreErrors)
+	re.True(ok)
+	re.Contains(storeErrs, uint64(1))
+}